@@ -0,0 +1,248 @@
+package signer
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// RequestToken is an unauthorized OAuth 1 request token returned by Consumer.GetRequestTokenAndURL,
+// to be exchanged for an AccessToken once the user has authorized it via the provider's AuthorizeURL.
+type RequestToken struct {
+	Token       string
+	TokenSecret string
+}
+
+// AccessToken is an OAuth 1 access token exchanged for an authorized RequestToken, used to sign
+// subsequent requests to the provider via Consumer.Sign.
+type AccessToken struct {
+	Token       string
+	TokenSecret string
+}
+
+// TokenStore persists tokens across the request-token, authorize and access-token steps of the
+// 3-legged OAuth 1 flow. The default memoryTokenStore keeps them in memory; a Tool Proxy
+// registration that spans a user's browser redirect across instances should plug in a shared
+// store (e.g. Redis or a DB) instead.
+type TokenStore interface {
+	SaveRequestToken(rt *RequestToken) error
+	RequestToken(token string) (*RequestToken, error)
+	SaveAccessToken(at *AccessToken) error
+}
+
+// memoryTokenStore is the default TokenStore, keeping tokens in memory. It is safe for
+// concurrent use.
+type memoryTokenStore struct {
+	mu            sync.Mutex
+	requestTokens map[string]*RequestToken
+	accessTokens  map[string]*AccessToken
+}
+
+// NewMemoryTokenStore returns a TokenStore that keeps tokens in memory for the lifetime of the
+// process.
+func NewMemoryTokenStore() TokenStore {
+	return &memoryTokenStore{
+		requestTokens: make(map[string]*RequestToken),
+		accessTokens:  make(map[string]*AccessToken),
+	}
+}
+
+func (m *memoryTokenStore) SaveRequestToken(rt *RequestToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requestTokens[rt.Token] = rt
+	return nil
+}
+
+func (m *memoryTokenStore) RequestToken(token string) (*RequestToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rt, ok := m.requestTokens[token]
+	if !ok {
+		return nil, errors.New("signer: unknown request token")
+	}
+	return rt, nil
+}
+
+func (m *memoryTokenStore) SaveAccessToken(at *AccessToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.accessTokens[at.Token] = at
+	return nil
+}
+
+// Consumer implements the full 3-legged OAuth 1 consumer flow (request-token -> authorize ->
+// access-token) required by LTI 2.0 Tool Proxy registration and by inbound integrations with
+// providers, such as Bitbucket Server or Gitea, that don't support the simplified two-legged LTI
+// launch Signer and Provider are built for.
+type Consumer struct {
+	Key    string
+	Secret string
+
+	RequestTokenURL string
+	AuthorizeURL    string
+	AccessTokenURL  string
+
+	// SignatureMethod selects the OAuth 1 signing algorithm used to sign the roundtrip's
+	// requests. Defaults to HMACSHA1 if left unset.
+	SignatureMethod SignatureMethod
+
+	// TokenStore persists tokens between steps of the roundtrip. Defaults to an in-memory store.
+	TokenStore TokenStore
+
+	// HTTPClient performs the request-token and access-token exchanges. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewConsumer returns a Consumer configured with the request-token, authorize and access-token
+// endpoints published by the provider, backed by an in-memory TokenStore.
+func NewConsumer(key string, secret string, requestTokenURL string, authorizeURL string, accessTokenURL string) *Consumer {
+	return &Consumer{
+		Key:             key,
+		Secret:          secret,
+		RequestTokenURL: requestTokenURL,
+		AuthorizeURL:    authorizeURL,
+		AccessTokenURL:  accessTokenURL,
+		TokenStore:      NewMemoryTokenStore(),
+		HTTPClient:      http.DefaultClient,
+	}
+}
+
+// GetRequestTokenAndURL exchanges callback for an unauthorized RequestToken at RequestTokenURL,
+// saves it via TokenStore and returns it along with the URL the user should be redirected to in
+// order to authorize it.
+func (c *Consumer) GetRequestTokenAndURL(callback string) (*RequestToken, string, error) {
+	s := Signer{
+		Method:          "POST",
+		URL:             c.RequestTokenURL,
+		Key:             c.Key,
+		Secret:          c.Secret,
+		SignatureMethod: c.signatureMethod(),
+		Form:            url.Values{"oauth_callback": {callback}},
+	}
+
+	respParams, err := c.doTokenRequest(s, c.RequestTokenURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rt := &RequestToken{
+		Token:       respParams.Get("oauth_token"),
+		TokenSecret: respParams.Get("oauth_token_secret"),
+	}
+	if rt.Token == "" || rt.TokenSecret == "" {
+		return nil, "", errors.New("signer: request token response missing oauth_token or oauth_token_secret")
+	}
+
+	if err := c.TokenStore.SaveRequestToken(rt); err != nil {
+		return nil, "", err
+	}
+
+	authorizeURL, err := url.Parse(c.AuthorizeURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	q := authorizeURL.Query()
+	q.Set("oauth_token", rt.Token)
+	authorizeURL.RawQuery = q.Encode()
+
+	return rt, authorizeURL.String(), nil
+}
+
+// AuthorizeToken exchanges rt and the verifier returned to the callback URL for an AccessToken at
+// AccessTokenURL, saving it via TokenStore.
+func (c *Consumer) AuthorizeToken(rt *RequestToken, verifier string) (*AccessToken, error) {
+	s := Signer{
+		Method:          "POST",
+		URL:             c.AccessTokenURL,
+		Key:             c.Key,
+		Secret:          c.Secret,
+		Token:           rt.Token,
+		TokenSecret:     rt.TokenSecret,
+		SignatureMethod: c.signatureMethod(),
+		Form:            url.Values{"oauth_verifier": {verifier}},
+	}
+
+	respParams, err := c.doTokenRequest(s, c.AccessTokenURL)
+	if err != nil {
+		return nil, err
+	}
+
+	at := &AccessToken{
+		Token:       respParams.Get("oauth_token"),
+		TokenSecret: respParams.Get("oauth_token_secret"),
+	}
+	if at.Token == "" || at.TokenSecret == "" {
+		return nil, errors.New("signer: access token response missing oauth_token or oauth_token_secret")
+	}
+
+	if err := c.TokenStore.SaveAccessToken(at); err != nil {
+		return nil, err
+	}
+
+	return at, nil
+}
+
+// Sign attaches a valid Authorization header to req on behalf of token, for use against the
+// resource endpoints the provider protects. It signs via SignRequest, so req.Body is hashed into
+// oauth_body_hash and a req.URL carrying a query string is rejected with an error.
+func (c *Consumer) Sign(req *http.Request, token *AccessToken) error {
+	return SignRequest(req, c.Key, c.Secret,
+		WithSignatureMethod(c.signatureMethod()),
+		WithToken(token.Token, token.TokenSecret),
+	)
+}
+
+// doTokenRequest POSTs s's signed form to endpoint and parses the response body as a
+// x-www-form-urlencoded token response.
+func (c *Consumer) doTokenRequest(s Signer, endpoint string) (url.Values, error) {
+	form, err := s.BuildAuthForm()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("signer: token request to " + endpoint + " failed with status " + resp.Status)
+	}
+
+	return url.ParseQuery(string(body))
+}
+
+func (c *Consumer) signatureMethod() SignatureMethod {
+	if c.SignatureMethod == "" {
+		return HMACSHA1
+	}
+	return c.SignatureMethod
+}
+
+func (c *Consumer) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
@@ -0,0 +1,114 @@
+package signer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestConsumerThreeLeggedRoundTrip(t *testing.T) {
+	const consumerKey = "tool-proxy"
+	const consumerSecret = "toolproxysecret"
+
+	var requestToken, accessToken string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/request_token":
+			requestToken = "reqtoken"
+			w.Write([]byte(url.Values{
+				"oauth_token":              {requestToken},
+				"oauth_token_secret":       {"reqsecret"},
+				"oauth_callback_confirmed": {"true"},
+			}.Encode()))
+		case "/access_token":
+			accessToken = "acctoken"
+			w.Write([]byte(url.Values{
+				"oauth_token":        {accessToken},
+				"oauth_token_secret": {"accsecret"},
+			}.Encode()))
+		case "/resource":
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewConsumer(consumerKey, consumerSecret, ts.URL+"/request_token", ts.URL+"/authorize", ts.URL+"/access_token")
+
+	rt, authURL, err := c.GetRequestTokenAndURL("http://tool.example.com/callback")
+	if err != nil {
+		t.Fatalf(`GetRequestTokenAndURL returned an error: %s`, err)
+	}
+	if rt.Token != "reqtoken" || rt.TokenSecret != "reqsecret" {
+		t.Errorf(`Unexpected request token: %+v`, rt)
+	}
+	if authURL != ts.URL+"/authorize?oauth_token=reqtoken" {
+		t.Errorf(`Unexpected authorize URL: %s`, authURL)
+	}
+
+	at, err := c.AuthorizeToken(rt, "verifier")
+	if err != nil {
+		t.Fatalf(`AuthorizeToken returned an error: %s`, err)
+	}
+	if at.Token != "acctoken" || at.TokenSecret != "accsecret" {
+		t.Errorf(`Unexpected access token: %+v`, at)
+	}
+
+	req, err := http.NewRequest("GET", ts.URL+"/resource", nil)
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+	if err := c.Sign(req, at); err != nil {
+		t.Fatalf(`Sign returned an error: %s`, err)
+	}
+	if req.Header.Get("Authorization") == "" {
+		t.Errorf(`Sign did not attach an Authorization header.`)
+	}
+}
+
+func TestGetRequestTokenAndURLPreservesExistingQuery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/request_token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(url.Values{
+			"oauth_token":              {"reqtoken"},
+			"oauth_token_secret":       {"reqsecret"},
+			"oauth_callback_confirmed": {"true"},
+		}.Encode()))
+	}))
+	defer ts.Close()
+
+	c := NewConsumer("tool-proxy", "toolproxysecret", ts.URL+"/request_token", ts.URL+"/authorize?tenant=acme", ts.URL+"/access_token")
+
+	_, authURL, err := c.GetRequestTokenAndURL("http://tool.example.com/callback")
+	if err != nil {
+		t.Fatalf(`GetRequestTokenAndURL returned an error: %s`, err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf(`Failed to parse authorize URL: %s`, err)
+	}
+
+	q := parsed.Query()
+	if q.Get("tenant") != "acme" || q.Get("oauth_token") != "reqtoken" {
+		t.Errorf(`Expected authorize URL to retain the existing query string and carry oauth_token, got: %s`, authURL)
+	}
+}
+
+func TestMemoryTokenStoreUnknownToken(t *testing.T) {
+	store := NewMemoryTokenStore()
+
+	if _, err := store.RequestToken("missing"); err == nil {
+		t.Error(`Expected an error looking up an unknown request token.`)
+	}
+}
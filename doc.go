@@ -20,5 +20,24 @@ Alternatively you can generate the signed data without the request, like so:
     }
 
     fmt.Println(n)
+
+For providers that need to verify inbound two-legged OAuth 1 requests, such as LTI launches and
+outcome service callbacks, use a Provider:
+
+    p := signer.NewProvider(func(consumerKey string) (string, error) {
+        return secretFor(consumerKey), nil
+    })
+
+    consumerKey, err := p.IsAuthorized(req)
+
+For the full 3-legged OAuth 1 roundtrip required by LTI 2.0 Tool Proxy registration, use a Consumer:
+
+    c := signer.NewConsumer("key", "secret", requestTokenURL, authorizeURL, accessTokenURL)
+
+    rt, authURL, err := c.GetRequestTokenAndURL(callbackURL)
+    // redirect the user to authURL, then once they return with a verifier:
+    at, err := c.AuthorizeToken(rt, verifier)
+    // at can now be used to sign requests:
+    err = c.Sign(req, at)
 */
 package signer
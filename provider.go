@@ -0,0 +1,310 @@
+package signer
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Errors returned by Provider.IsAuthorized when a request fails OAuth verification.
+var (
+	ErrMissingOAuthParams = errors.New("signer: request is missing required OAuth parameters")
+	ErrUnknownConsumerKey = errors.New("signer: unknown oauth_consumer_key")
+	ErrTimestampOutOfSkew = errors.New("signer: oauth_timestamp is outside the allowed skew window")
+	ErrNonceReplayed      = errors.New("signer: oauth_nonce has already been used")
+	ErrBadBodyHash        = errors.New("signer: oauth_body_hash does not match the request body")
+	ErrBadSignature       = errors.New("signer: oauth_signature is invalid")
+)
+
+// NonceStore tracks which (consumer key, nonce) pairs have already been seen so that
+// Provider.IsAuthorized can reject replayed requests. Claim should return false, nil the
+// second time it is called with the same consumerKey and nonce.
+type NonceStore interface {
+	// Claim records that nonce was used by consumerKey at timestamp, returning true if this is
+	// the first time the pair has been seen and false if it has already been claimed.
+	Claim(consumerKey string, nonce string, timestamp time.Time) (bool, error)
+}
+
+// memoryNonceStore is the default NonceStore, an in-memory map of claimed nonces that are
+// expired after ttl has elapsed. It is safe for concurrent use.
+type memoryNonceStore struct {
+	mu      sync.Mutex
+	claimed map[string]time.Time
+	ttl     time.Duration
+}
+
+// NewMemoryNonceStore returns a NonceStore that keeps claimed nonces in memory, forgetting them
+// once ttl has passed since they were claimed. It is suitable for single-instance deployments;
+// multi-instance deployments should plug in a shared store (e.g. Redis) instead.
+func NewMemoryNonceStore(ttl time.Duration) NonceStore {
+	return &memoryNonceStore{
+		claimed: make(map[string]time.Time),
+		ttl:     ttl,
+	}
+}
+
+func (m *memoryNonceStore) Claim(consumerKey string, nonce string, timestamp time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.evictExpired(timestamp)
+
+	key := consumerKey + "&" + nonce
+	if _, seen := m.claimed[key]; seen {
+		return false, nil
+	}
+
+	m.claimed[key] = timestamp
+	return true, nil
+}
+
+// evictExpired removes claimed nonces older than ttl. Callers must hold m.mu.
+func (m *memoryNonceStore) evictExpired(now time.Time) {
+	for k, t := range m.claimed {
+		if now.Sub(t) > m.ttl {
+			delete(m.claimed, k)
+		}
+	}
+}
+
+// SecretGetter resolves the shared secret for an OAuth consumer key, used by Provider to
+// re-derive the expected signature for an inbound request.
+type SecretGetter func(consumerKey string) (string, error)
+
+// Provider verifies inbound two-legged OAuth 1 signed requests, such as LTI launches and
+// outcome service callbacks, as opposed to Signer which only produces them.
+type Provider struct {
+	// SecretGetter resolves the shared secret belonging to an oauth_consumer_key.
+	SecretGetter SecretGetter
+
+	// NonceStore rejects requests that reuse a previously seen nonce. Defaults to an in-memory
+	// store with a TTL of twice TimestampSkew.
+	NonceStore NonceStore
+
+	// TimestampSkew is how far oauth_timestamp may drift from the current time and still be
+	// accepted. Defaults to 5 minutes.
+	TimestampSkew time.Duration
+}
+
+// NewProvider returns a Provider that resolves consumer secrets via secretGetter, with the
+// default TimestampSkew and an in-memory NonceStore.
+func NewProvider(secretGetter SecretGetter) *Provider {
+	skew := 5 * time.Minute
+
+	return &Provider{
+		SecretGetter:  secretGetter,
+		NonceStore:    NewMemoryNonceStore(2 * skew),
+		TimestampSkew: skew,
+	}
+}
+
+// IsAuthorized verifies that r carries a valid two-legged OAuth 1 signature: it buffers and
+// rewinds the request body up front, parses the OAuth parameters from the Authorization header,
+// the URL query and the buffered form body (merging all three, per RFC 5849 §3.4.1.3), rebuilds
+// the absolute URL (honouring X-Forwarded-Proto/X-Forwarded-Host behind a reverse proxy), checks
+// oauth_body_hash against the actual request body, enforces the timestamp skew window and
+// recomputes the signature. Only once the signature has been verified is oauth_nonce claimed
+// against NonceStore, so a badly signed request can never burn a nonce a later, legitimately
+// signed request needs. The request body is rewound up front so downstream handlers can still
+// read it regardless of which param source was used. On success it returns the request's
+// oauth_consumer_key.
+func (p *Provider) IsAuthorized(r *http.Request) (string, error) {
+	body, err := readAndRestoreBody(r)
+	if err != nil {
+		return "", err
+	}
+
+	params, err := parseOAuthParams(r, body)
+	if err != nil {
+		return "", err
+	}
+
+	consumerKey := params.Get("oauth_consumer_key")
+	if consumerKey == "" || params.Get("oauth_nonce") == "" || params.Get("oauth_timestamp") == "" || params.Get("oauth_signature") == "" {
+		return "", ErrMissingOAuthParams
+	}
+
+	ts, err := strconv.ParseInt(params.Get("oauth_timestamp"), 10, 64)
+	if err != nil {
+		return "", ErrMissingOAuthParams
+	}
+
+	timestamp := time.Unix(ts, 0)
+	skew := p.TimestampSkew
+	if skew == 0 {
+		skew = 5 * time.Minute
+	}
+
+	now := time.Now()
+	if timestamp.Before(now.Add(-skew)) || timestamp.After(now.Add(skew)) {
+		return "", ErrTimestampOutOfSkew
+	}
+
+	secret, err := p.SecretGetter(consumerKey)
+	if err != nil {
+		return "", ErrUnknownConsumerKey
+	}
+
+	if hash := params.Get("oauth_body_hash"); hash != "" {
+		s := Signer{Body: string(body)}
+		if s.bodyHash() != hash {
+			return "", ErrBadBodyHash
+		}
+	}
+
+	in := params.Get("oauth_signature")
+	params.Del("oauth_signature")
+
+	s := Signer{
+		Method:          r.Method,
+		URL:             absoluteURL(r),
+		Secret:          secret,
+		SignatureMethod: SignatureMethod(params.Get("oauth_signature_method")),
+	}
+
+	gen, err := s.signRequest(params)
+	if err != nil {
+		return "", err
+	}
+
+	if in != gen {
+		log.WithFields(log.Fields{"Consumer Key": consumerKey}).Warn("OAuth signature did not match inbound request.")
+		return "", ErrBadSignature
+	}
+
+	store := p.NonceStore
+	if store == nil {
+		store = NewMemoryNonceStore(2 * skew)
+		p.NonceStore = store
+	}
+
+	fresh, err := store.Claim(consumerKey, params.Get("oauth_nonce"), timestamp)
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", ErrNonceReplayed
+	}
+
+	return consumerKey, nil
+}
+
+// Middleware returns an http.Handler that verifies r with IsAuthorized before delegating to
+// next, responding 401 Unauthorized if verification fails.
+func (p *Provider) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := p.IsAuthorized(r); err != nil {
+			log.WithFields(log.Fields{"Error": err}).Warn("Rejected unauthorized request.")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseOAuthParams extracts the OAuth parameters from r: the URL query, the buffered form body
+// (body is the result of the caller's prior readAndRestoreBody; it is parsed directly rather than
+// via r.ParseForm so that the rewound r.Body is left unread for downstream handlers) and the
+// Authorization header (as used by most LTI tool providers) are all merged into one parameter
+// set, per RFC 5849 §3.4.1.3 — the oauth_ parameters may arrive via the header while
+// non-oauth_ parameters (e.g. a callback's resource id) still ride along on the query string or
+// form body, and all of them must be covered by the signature. All values of a repeated
+// parameter (e.g. a roles list) are preserved, not just the first.
+func parseOAuthParams(r *http.Request, body []byte) (url.Values, error) {
+	params := url.Values{}
+
+	for k, vs := range r.URL.Query() {
+		params[k] = append(params[k], vs...)
+	}
+
+	if isFormURLEncoded(r) {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, vs := range form {
+			params[k] = append(params[k], vs...)
+		}
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "OAuth") {
+		for _, part := range strings.Split(strings.TrimPrefix(auth, "OAuth"), ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			key := strings.TrimSpace(kv[0])
+			if key == "realm" {
+				continue
+			}
+
+			value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+
+			unescaped, err := url.QueryUnescape(value)
+			if err != nil {
+				return nil, err
+			}
+
+			params.Add(key, unescaped)
+		}
+	}
+
+	return params, nil
+}
+
+// isFormURLEncoded reports whether r's Content-Type is application/x-www-form-urlencoded, in
+// which case its body should be parsed as form parameters rather than treated as an opaque
+// payload (e.g. a grade-passback XML body signed via oauth_body_hash instead).
+func isFormURLEncoded(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+}
+
+// absoluteURL rebuilds the absolute URL a request was made to, honouring the X-Forwarded-Proto
+// and X-Forwarded-Host headers set by a reverse proxy in front of the tool.
+func absoluteURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+
+	return scheme + "://" + host + r.URL.Path
+}
+
+// readAndRestoreBody reads r.Body and resets it so it can still be read by downstream handlers.
+func readAndRestoreBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	return body, nil
+}
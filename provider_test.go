@@ -0,0 +1,250 @@
+package signer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, secret string) *http.Request {
+	s := NewSigner("POST", "http://example.com/launch", "1000", secret, "", nil)
+
+	form := url.Values{"resource_link_id": {"12345"}}
+	s.Form = form
+
+	authed, err := s.BuildAuthForm()
+	if err != nil {
+		t.Fatalf(`Failed to build auth form: %s`, err)
+	}
+
+	req, err := http.NewRequest("POST", "http://example.com/launch", strings.NewReader(authed))
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Host = "example.com"
+
+	return req
+}
+
+func TestProviderIsAuthorized(t *testing.T) {
+	p := NewProvider(func(consumerKey string) (string, error) {
+		if consumerKey != "1000" {
+			t.Errorf(`Unexpected consumer key: %s`, consumerKey)
+		}
+		return "secret", nil
+	})
+
+	req := signedRequest(t, "secret")
+
+	key, err := p.IsAuthorized(req)
+	if err != nil {
+		t.Errorf(`IsAuthorized returned an error: %s`, err)
+	}
+	if key != "1000" {
+		t.Errorf(`Expected consumer key "1000", got %s`, key)
+	}
+}
+
+func TestProviderIsAuthorizedWrongSecret(t *testing.T) {
+	p := NewProvider(func(consumerKey string) (string, error) {
+		return "wrongsecret", nil
+	})
+
+	req := signedRequest(t, "secret")
+
+	if _, err := p.IsAuthorized(req); err != ErrBadSignature {
+		t.Errorf(`Expected ErrBadSignature, got: %s`, err)
+	}
+}
+
+func TestProviderIsAuthorizedReplayedNonce(t *testing.T) {
+	p := NewProvider(func(consumerKey string) (string, error) {
+		return "secret", nil
+	})
+
+	req := signedRequest(t, "secret")
+	body, err := readAndRestoreBody(req)
+	if err != nil {
+		t.Fatalf(`Failed to read request body: %s`, err)
+	}
+
+	if _, err := p.IsAuthorized(req); err != nil {
+		t.Fatalf(`First request should have been authorized: %s`, err)
+	}
+
+	replay, err := http.NewRequest("POST", "http://example.com/launch", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf(`Failed to build replay request: %s`, err)
+	}
+	replay.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	replay.Host = "example.com"
+
+	if _, err := p.IsAuthorized(replay); err != ErrNonceReplayed {
+		t.Errorf(`Expected ErrNonceReplayed, got: %s`, err)
+	}
+}
+
+// headerSignedRequest builds a request authorized via the Authorization header (rather than a
+// signed form body), signing signedQuery as part of the OAuth parameter set. rawURL is the
+// actual URL the request is sent to, which may carry a different (or no) query string.
+func headerSignedRequest(t *testing.T, secret string, rawURL string, signedQuery url.Values) *http.Request {
+	req, err := http.NewRequest("POST", rawURL, nil)
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+	req.Host = "example.com"
+
+	params := url.Values{}
+	for k, vs := range signedQuery {
+		params[k] = append([]string(nil), vs...)
+	}
+	params.Set("oauth_version", "1.0")
+	params.Set("oauth_nonce", "headernonce")
+	params.Set("oauth_timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	params.Set("oauth_consumer_key", "1000")
+	params.Set("oauth_signature_method", string(HMACSHA1))
+	params.Set("oauth_body_hash", emptyBodyHash())
+
+	s := Signer{Method: "POST", URL: "http://example.com" + req.URL.Path, Secret: secret}
+	sig, err := s.signRequest(params)
+	if err != nil {
+		t.Fatalf(`signRequest returned an error: %s`, err)
+	}
+	params.Set("oauth_signature", sig)
+
+	// Only the oauth_ parameters belong in the header itself; assignment_id (if any) is signed
+	// over because it rides the request's query string, exactly as a real outcome-service
+	// callback would carry it.
+	authHeader := `OAuth realm=""`
+	for k, v := range params {
+		if !strings.HasPrefix(k, "oauth_") {
+			continue
+		}
+		authHeader += fmt.Sprintf(`,%s="%s"`, escape(k), escape(v[0]))
+	}
+	req.Header.Set("Authorization", authHeader)
+
+	return req
+}
+
+func TestProviderIsAuthorizedHeaderCoversQueryString(t *testing.T) {
+	p := NewProvider(func(consumerKey string) (string, error) {
+		return "secret", nil
+	})
+
+	signedQuery := url.Values{"assignment_id": {"999"}}
+
+	req := headerSignedRequest(t, "secret", "http://example.com/callback?assignment_id=999", signedQuery)
+
+	if _, err := p.IsAuthorized(req); err != nil {
+		t.Errorf(`Expected a header-signed request whose query string matches what was signed to be authorized, got: %s`, err)
+	}
+}
+
+func TestProviderIsAuthorizedHeaderRejectsTamperedQueryString(t *testing.T) {
+	p := NewProvider(func(consumerKey string) (string, error) {
+		return "secret", nil
+	})
+
+	// Sign over no query parameters at all, then replay the identical header against a request
+	// carrying a query string. Before parseOAuthParams merged r.URL.Query() into the header
+	// branch's params, this tampering went unnoticed and IsAuthorized returned success.
+	req := headerSignedRequest(t, "secret", "http://example.com/callback?assignment_id=999", url.Values{})
+
+	if _, err := p.IsAuthorized(req); err != ErrBadSignature {
+		t.Errorf(`Expected ErrBadSignature for a query string injected after signing, got: %s`, err)
+	}
+}
+
+func TestProviderIsAuthorizedBadSignatureDoesNotBurnNonce(t *testing.T) {
+	p := NewProvider(func(consumerKey string) (string, error) {
+		return "secret", nil
+	})
+
+	const nonce = "shared-nonce"
+
+	bad := formRequestWithNonce(t, "wrongsecret", nonce)
+	if _, err := p.IsAuthorized(bad); err != ErrBadSignature {
+		t.Fatalf(`Expected ErrBadSignature for the badly signed request, got: %s`, err)
+	}
+
+	// If the bad request above had already claimed the nonce (as it did before the nonce claim
+	// was moved past signature verification), this correctly signed request reusing the same
+	// nonce would be wrongly rejected as a replay.
+	good := formRequestWithNonce(t, "secret", nonce)
+	if _, err := p.IsAuthorized(good); err != nil {
+		t.Errorf(`Expected the correctly signed request to be authorized, got: %s`, err)
+	}
+}
+
+// formRequestWithNonce builds a form-signed request like signedRequest, but with an
+// attacker-chosen oauth_nonce rather than a random one, so tests can prove a nonce wasn't
+// claimed when it shouldn't have been.
+func formRequestWithNonce(t *testing.T, secret string, nonce string) *http.Request {
+	form := url.Values{
+		"oauth_version":          {"1.0"},
+		"oauth_nonce":            {nonce},
+		"oauth_timestamp":        {strconv.FormatInt(time.Now().Unix(), 10)},
+		"oauth_consumer_key":     {"1000"},
+		"oauth_signature_method": {string(HMACSHA1)},
+		"resource_link_id":       {"12345"},
+	}
+
+	s := Signer{Method: "POST", URL: "http://example.com/launch", Secret: secret}
+	sig, err := s.signRequest(form)
+	if err != nil {
+		t.Fatalf(`signRequest returned an error: %s`, err)
+	}
+	form.Set("oauth_signature", sig)
+
+	req, err := http.NewRequest("POST", "http://example.com/launch", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Host = "example.com"
+
+	return req
+}
+
+func TestProviderMiddleware(t *testing.T) {
+	p := NewProvider(func(consumerKey string) (string, error) {
+		return "secret", nil
+	})
+
+	handler := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest(t, "wrongsecret"))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf(`Expected 401, got %d`, rec.Code)
+	}
+}
+
+func TestMemoryNonceStoreExpiry(t *testing.T) {
+	store := NewMemoryNonceStore(10 * time.Millisecond)
+
+	fresh, err := store.Claim("key", "nonce", time.Now())
+	if err != nil || !fresh {
+		t.Errorf(`Expected first claim to succeed, fresh=%v err=%s`, fresh, err)
+	}
+
+	fresh, err = store.Claim("key", "nonce", time.Now())
+	if err != nil || fresh {
+		t.Errorf(`Expected second claim to be rejected as a replay`)
+	}
+
+	fresh, err = store.Claim("key", "nonce", time.Now().Add(time.Hour))
+	if err != nil || !fresh {
+		t.Errorf(`Expected claim to succeed again once the nonce has expired`)
+	}
+}
@@ -1,14 +1,20 @@
 // Package signer is used to generate the OAuth signed requests and is built solely for the purpose of use in LTI requests.
-// LTI doesn't need the full OAuth 1 roundtrip, it's basically single legged. We simply need the signing functions to authorize
-// the requests (as per LTI spec).
+// Most LTI launches and callbacks are two-legged: Signer and Provider are enough to sign and verify them. LTI 2.0 Tool
+// Proxy registration and integrations with providers like Bitbucket Server or Gitea do need the full request-token ->
+// authorize -> access-token roundtrip, which Consumer implements.
 package signer
 
 import (
+	"crypto"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"hash"
 	"net/http"
 	"net/url"
 	"sort"
@@ -21,32 +27,70 @@ import (
 	log "github.com/Sirupsen/logrus"
 )
 
+// SignatureMethod identifies which OAuth 1 signing algorithm a Signer uses to produce
+// (and verify) the oauth_signature parameter.
+type SignatureMethod string
+
+// Supported OAuth 1 signature methods. HMACSHA1 is the default used when a Signer's
+// SignatureMethod is left unset, matching the original LTI 1.0/1.1 behaviour.
+const (
+	HMACSHA1   SignatureMethod = "HMAC-SHA1"
+	HMACSHA256 SignatureMethod = "HMAC-SHA256"
+	RSASHA1    SignatureMethod = "RSA-SHA1"
+)
+
+// PublicKeyResolver looks up the RSA public key belonging to an OAuth consumer key so that
+// ValidateSignature can verify RSA-SHA1 signed requests.
+type PublicKeyResolver func(consumerKey string) (*rsa.PublicKey, error)
+
 // ValidateSignature takes the URL, params and secret and generates a signature. It then pulls the signature from the params
 // and compares what we created with what was passed in to determine whether it was correct or not.
-func ValidateSignature(url string, form url.Values, secret string) bool {
-	s := Signer{
-		URL:    url,
-		Secret: secret,
+//
+// It dispatches on the incoming oauth_signature_method: HMAC-SHA1 and HMAC-SHA256 are verified against secret,
+// RSA-SHA1 is verified against the consumer's public key as returned by resolver. resolver may be nil if RSA-SHA1
+// requests are not expected; any such request will then fail verification.
+//
+// form is iterated by all of its values per key, not just the first, so that requests with
+// repeated parameter names (e.g. a roles list) verify correctly.
+func ValidateSignature(rawURL string, form url.Values, secret string, resolver PublicKeyResolver) bool {
+	params := url.Values{}
+	for k, vs := range form {
+		params[k] = append([]string(nil), vs...)
 	}
 
-	params := make(map[string]string)
+	in := params.Get("oauth_signature")
 
-	for k := range form {
-		params[k] = form.Get(k)
-	}
+	// delete oauth signature from params since it's never used in generation
+	params.Del("oauth_signature")
 
-	in := params["oauth_signature"]
+	method := SignatureMethod(params.Get("oauth_signature_method"))
 
-	// delete oauth signature from params since it's never used in generation
-	delete(params, "oauth_signature")
+	if method == RSASHA1 {
+		if resolver == nil {
+			return false
+		}
+
+		pub, err := resolver(params.Get("oauth_consumer_key"))
+		if err != nil {
+			return false
+		}
 
-	gen := s.signRequest(params)
+		s := Signer{URL: rawURL, SignatureMethod: RSASHA1}
+		return s.verifyRSA(s.createBaseString(params), in, pub) == nil
+	}
+
+	s := Signer{
+		URL:             rawURL,
+		Secret:          secret,
+		SignatureMethod: method,
+	}
 
-	if in != gen {
+	gen, err := s.signRequest(params)
+	if err != nil {
 		return false
 	}
 
-	return true
+	return in == gen
 }
 
 // SignedBodyRequest returns an http.Request with the body appended and a valid authorization header attached.
@@ -70,9 +114,16 @@ func SignedBodyRequest(method string, url string, key string, secret string, bod
 }
 
 // SignedFormRequest is for creating a post request and correctly calculate the oAuth signature for LTI launches.
-// It takes in a key value string pair and returns an Request object for you to work with.
+// It takes in a key value string pair and returns an Request object for you to work with. Kept for backward
+// compatibility; use SignedFormRequestValues if the form has repeated parameter names (e.g. a roles list).
 func SignedFormRequest(url string, key string, secret string, params map[string]string) (*http.Request, error) {
-	s := NewSigner("POST", url, key, secret, "", params)
+	return SignedFormRequestValues(url, key, secret, mapToValues(params))
+}
+
+// SignedFormRequestValues is the url.Values equivalent of SignedFormRequest, for requests whose form carries
+// repeated parameter names.
+func SignedFormRequestValues(url string, key string, secret string, params url.Values) (*http.Request, error) {
+	s := NewSignerValues("POST", url, key, secret, "", params)
 
 	form, err := s.BuildAuthForm()
 	if err != nil {
@@ -89,8 +140,14 @@ func SignedFormRequest(url string, key string, secret string, params map[string]
 	return request, nil
 }
 
-// NewSigner returns a Signer struct
+// NewSigner returns a Signer struct. Kept for backward compatibility; use NewSignerValues if the form has
+// repeated parameter names (e.g. a roles list), since map[string]string can only hold one value per key.
 func NewSigner(method string, url string, key string, secret string, body string, form map[string]string) Signer {
+	return NewSignerValues(method, url, key, secret, body, mapToValues(form))
+}
+
+// NewSignerValues is the url.Values equivalent of NewSigner, for forms whose parameter names repeat.
+func NewSignerValues(method string, url string, key string, secret string, body string, form url.Values) Signer {
 	return Signer{
 		Method: method,
 		URL:    url,
@@ -101,6 +158,19 @@ func NewSigner(method string, url string, key string, secret string, body string
 	}
 }
 
+// mapToValues converts the legacy map[string]string form representation into url.Values.
+func mapToValues(form map[string]string) url.Values {
+	if form == nil {
+		return nil
+	}
+
+	values := url.Values{}
+	for k, v := range form {
+		values.Set(k, v)
+	}
+	return values
+}
+
 // Signer represents the data needed to create a valid OAuth signed request for LTI
 type Signer struct {
 	// The HTTP method to be used in the request and signing
@@ -117,8 +187,31 @@ type Signer struct {
 	// These both represent the different bodies of the LTI requets that need to be signed,
 	// it's generally one or the other. E.g. Body when you need to send data in a callback to
 	// an LTI consumer or Form when you want to sign an LTI form request to a provider.
+	//
+	// Form is url.Values rather than map[string]string because OAuth 1.0a signature base
+	// strings must preserve repeated parameter names (e.g. a roles list or LTI custom params).
 	Body string
-	Form map[string]string
+	Form url.Values
+
+	// SignatureMethod selects the OAuth 1 signing algorithm to use. If left unset it defaults
+	// to HMACSHA1, preserving the original LTI 1.0 behaviour.
+	SignatureMethod SignatureMethod
+
+	// PrivateKey is required when SignatureMethod is RSASHA1 and is used to sign the base
+	// string in place of the HMAC key. It is ignored for the HMAC signature methods.
+	PrivateKey *rsa.PrivateKey
+
+	// Token and TokenSecret are set when signing on behalf of a 3-legged OAuth 1 Consumer, e.g.
+	// after Consumer.AuthorizeToken has exchanged a RequestToken for an AccessToken. Token is
+	// included in the signed params as oauth_token and TokenSecret is appended to the HMAC key.
+	// Both are left empty for the two-legged LTI launch/callback flows.
+	Token       string
+	TokenSecret string
+
+	// BodyHash, if set, is used directly as the oauth_body_hash value instead of being derived by
+	// hashing Body. SignRequest sets this so that a large body never needs to be held fully in
+	// memory just to be hashed.
+	BodyHash string
 }
 
 // BuildAuthHeader generates an Authorization header to be used in requests, it's used when needing to
@@ -127,18 +220,28 @@ type Signer struct {
 // For example: grade passback, this callback requires an XML body with the grade be passed back to the LTI
 // consumer with a signed authorization header.
 func (s Signer) BuildAuthHeader() (string, error) {
-	params := make(map[string]string)
-	s.addDefaultOAuthParams(params)
+	params := url.Values{}
+	if err := s.addDefaultOAuthParams(params); err != nil {
+		return "", err
+	}
 
-	params["oauth_body_hash"] = s.bodyHash()
+	hash := s.BodyHash
+	if hash == "" {
+		hash = s.bodyHash()
+	}
+	params.Set("oauth_body_hash", hash)
 
 	// generates signature based on params map and appends to the end of the map
-	params["oauth_signature"] = s.signRequest(params)
+	sig, err := s.signRequest(params)
+	if err != nil {
+		return "", err
+	}
+	params.Set("oauth_signature", sig)
 
 	authHeader := `OAuth realm=""`
 
 	for k, v := range params {
-		authHeader += fmt.Sprintf(`,%s="%s"`, escape(k), escape(v))
+		authHeader += fmt.Sprintf(`,%s="%s"`, escape(k), escape(v[0]))
 	}
 
 	log.WithFields(log.Fields{"Auth Header": authHeader}).Info("Authorization header created.")
@@ -158,45 +261,101 @@ func (s Signer) BuildAuthForm() (string, error) {
 		return "", err
 	}
 
-	s.Form["oauth_signature"] = s.signRequest(s.Form)
+	sig, err := s.signRequest(s.Form)
+	if err != nil {
+		return "", err
+	}
+	s.Form.Set("oauth_signature", sig)
 
 	return s.escapeParams(s.Form), nil
 }
 
 // Adds the default oAuth params apart from oauth_body_hash and oauth_signature since these will be generated on the fly.
 // This is simply a helper to append the commonly used OAuth params to the different type of requests.
-func (s Signer) addDefaultOAuthParams(params map[string]string) error {
+func (s Signer) addDefaultOAuthParams(params url.Values) error {
 	n, err := util.RandomString(15)
 	if err != nil {
 		return err
 	}
 
-	params["oauth_version"] = "1.0"
-	params["oauth_nonce"] = n
-	params["oauth_timestamp"] = strconv.FormatInt(time.Now().Unix(), 10)
-	params["oauth_consumer_key"] = s.Key
-	params["oauth_signature_method"] = "HMAC-SHA1"
+	method := s.SignatureMethod
+	if method == "" {
+		method = HMACSHA1
+	}
+
+	params.Set("oauth_version", "1.0")
+	params.Set("oauth_nonce", n)
+	params.Set("oauth_timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	params.Set("oauth_consumer_key", s.Key)
+	params.Set("oauth_signature_method", string(method))
+
+	if s.Token != "" {
+		params.Set("oauth_token", s.Token)
+	}
 
 	return nil
 }
 
 // signRequest handles the creation of the base string and the signing of that base string
-// to create the end oauth_signature parameter.
-func (s Signer) signRequest(params map[string]string) string {
+// to create the end oauth_signature parameter. It switches on SignatureMethod to decide
+// whether to HMAC or RSA sign the base string.
+func (s Signer) signRequest(params url.Values) (string, error) {
 
 	baseString := s.createBaseString(params)
 
-	// Ampersand appended due to oAuth 1.0 spec
-	secret := s.Secret + "&"
+	switch s.SignatureMethod {
+	case HMACSHA256:
+		return s.hmacSign(sha256.New, baseString), nil
+	case RSASHA1:
+		return s.rsaSign(baseString)
+	default:
+		return s.hmacSign(sha1.New, baseString), nil
+	}
+}
 
-	mac := hmac.New(sha1.New, []byte(secret))
+// hmacSign signs baseString with the given hash constructor, using secret + "&" + tokenSecret as
+// the HMAC key per the OAuth 1.0 spec. TokenSecret is empty for the two-legged LTI flows, so this
+// reduces to secret + "&" as before.
+func (s Signer) hmacSign(newHash func() hash.Hash, baseString string) string {
+	secret := s.Secret + "&" + s.TokenSecret
+
+	mac := hmac.New(newHash, []byte(secret))
 	mac.Write([]byte(baseString))
 
 	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
 
+// rsaSign signs baseString with s.PrivateKey using RSA-SHA1, as required for RSA-SHA1 signed
+// LTI Tool Proxy registration requests.
+func (s Signer) rsaSign(baseString string) (string, error) {
+	if s.PrivateKey == nil {
+		return "", errors.New("RSA-SHA1 signature method requires a PrivateKey")
+	}
+
+	hashed := sha1.Sum([]byte(baseString))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.PrivateKey, crypto.SHA1, hashed[:])
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// verifyRSA verifies that sig is a valid RSA-SHA1 signature of baseString under pub.
+func (s Signer) verifyRSA(baseString string, sig string, pub *rsa.PublicKey) error {
+	decoded, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha1.Sum([]byte(baseString))
+
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA1, hashed[:], decoded)
+}
+
 // createBaseString builds up a base string to be hashed and used as a signature.
-func (s Signer) createBaseString(params map[string]string) string {
+func (s Signer) createBaseString(params url.Values) string {
 	baseString := s.Method + "&" + escape(s.URL) + "&"
 
 	baseString = baseString + escape(s.escapeParams(params))
@@ -214,31 +373,48 @@ func (s Signer) bodyHash() string {
 	return base64.StdEncoding.EncodeToString(hasher.Sum(nil))
 }
 
-// Escapes params for a standard LTI launch, doesn't encode the equals
-func (s Signer) escapeParams(params map[string]string) string {
+// kvPair is a single OAuth parameter name/value, used to sort repeated parameter names by
+// value as required by RFC 5849 §3.4.1.3.2.
+type kvPair struct {
+	key   string
+	value string
+}
 
-	var paramString string
+// Escapes params for a standard LTI launch, doesn't encode the equals. Pairs are sorted first
+// by key then by value so that repeated parameter names (e.g. a roles list) produce a
+// deterministic, spec-compliant base string.
+func (s Signer) escapeParams(params url.Values) string {
 
-	keys := sortKeys(params)
+	pairs := sortedPairs(params)
 
-	for i, key := range keys {
+	var paramString string
+	for i, pair := range pairs {
 		if i > 0 {
 			paramString += "&"
 		}
-		paramString += escape(key) + "=" + escape(params[key])
+		paramString += escape(pair.key) + "=" + escape(pair.value)
 	}
 	return paramString
 }
 
-// sortKeys iterates over the map passed in and returns a slice of string keys
-// which are now alphabetically ordered.
-func sortKeys(params map[string]string) []string {
-	var keys []string
-	for k := range params {
-		keys = append(keys, k)
+// sortedPairs flattens params into kvPair entries, one per value, sorted by key and then by
+// value per RFC 5849 §3.4.1.3.2.
+func sortedPairs(params url.Values) []kvPair {
+	var pairs []kvPair
+	for k, values := range params {
+		for _, v := range values {
+			pairs = append(pairs, kvPair{key: k, value: v})
+		}
 	}
-	sort.Strings(keys)
-	return keys
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+
+	return pairs
 }
 
 func escape(s string) string {
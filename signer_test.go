@@ -1,7 +1,10 @@
 package signer
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -31,7 +34,7 @@ var formParams = map[string]string{
 }
 
 func TestSignedBodyRequest(t *testing.T) {
-	req, _ := SignedBodyRequest("http://example.com", "1234", "abcd", body)
+	req, _ := SignedBodyRequest("POST", "http://example.com", "1234", "abcd", body)
 
 	if req.Header.Get("Authorization") == "" {
 		t.Errorf(`Authorization head does not exist.`)
@@ -39,7 +42,7 @@ func TestSignedBodyRequest(t *testing.T) {
 }
 
 func TestBuildAuthHeader(t *testing.T) {
-	s := NewSigner("http://example.com", "1234", "abcd", "test body", nil)
+	s := NewSigner("POST", "http://example.com", "1234", "abcd", "test body", nil)
 	s.BuildAuthHeader()
 
 	h, _ := s.BuildAuthHeader()
@@ -50,7 +53,7 @@ func TestBuildAuthHeader(t *testing.T) {
 
 func TestBodyHash(t *testing.T) {
 	hash := "8zvVCDnUBUsiOMVnRz9Ahc8bPWU="
-	s := NewSigner("http://example.com", "1234", "abcd", body, nil)
+	s := NewSigner("POST", "http://example.com", "1234", "abcd", body, nil)
 	genhash := s.bodyHash()
 
 	if genhash != hash {
@@ -81,7 +84,7 @@ func TestEscape(t *testing.T) {
 		in  string
 		out string
 	}{
-		{"abcd1234$Â£@!&", "abcd1234%24%C2%A3%40%21%26"},
+		{"abcd1234$£@!&", "abcd1234%24%C2%A3%40%21%26"},
 		{"&", "%26"},
 		{" ", "%20"},
 		{"@", "%40"},
@@ -95,7 +98,7 @@ func TestEscape(t *testing.T) {
 	}
 }
 
-func TestSortKeys(t *testing.T) {
+func TestSortedPairs(t *testing.T) {
 	sorted := []string{
 		"oauth_body_hash",
 		"oauth_consumer_key",
@@ -105,37 +108,49 @@ func TestSortKeys(t *testing.T) {
 		"oauth_version",
 	}
 
-	params := map[string]string{
-		"oauth_version":          "1.0",
-		"oauth_nonce":            "random",
-		"oauth_timestamp":        "timestamp",
-		"oauth_consumer_key":     "abc123",
-		"oauth_body_hash":        "bodyhash",
-		"oauth_signature_method": "HMAC-SHA1",
+	params := url.Values{
+		"oauth_version":          {"1.0"},
+		"oauth_nonce":            {"random"},
+		"oauth_timestamp":        {"timestamp"},
+		"oauth_consumer_key":     {"abc123"},
+		"oauth_body_hash":        {"bodyhash"},
+		"oauth_signature_method": {"HMAC-SHA1"},
 	}
 
-	keys := sortKeys(params)
+	pairs := sortedPairs(params)
 
-	for k, v := range keys {
-		if v != sorted[k] {
-			t.Errorf(`Sorted key: %s doesn't match presorted key: %s`, v, sorted[k])
+	for i, pair := range pairs {
+		if pair.key != sorted[i] {
+			t.Errorf(`Sorted key: %s doesn't match presorted key: %s`, pair.key, sorted[i])
 			break
 		}
 	}
 }
 
+func TestSortedPairsRepeatedKey(t *testing.T) {
+	params := url.Values{
+		"roles": {"Learner", "Instructor"},
+	}
+
+	pairs := sortedPairs(params)
+
+	if len(pairs) != 2 || pairs[0].value != "Instructor" || pairs[1].value != "Learner" {
+		t.Errorf(`Expected repeated key values to be sorted by value, got: %v`, pairs)
+	}
+}
+
 func TestCreateBaseString(t *testing.T) {
 	gen := `POST&http%3A%2F%2Fexample.com&oauth_body_hash%3Dbodyhash%26oauth_consumer_key%3Dabc123%26oauth_nonce%3Drandom%26oauth_signature_method%3DHMAC-SHA1%26oauth_timestamp%3Dtimestamp%26oauth_version%3D1.0`
-	params := map[string]string{
-		"oauth_version":          "1.0",
-		"oauth_nonce":            "random",
-		"oauth_timestamp":        "timestamp",
-		"oauth_consumer_key":     "abc123",
-		"oauth_body_hash":        "bodyhash",
-		"oauth_signature_method": "HMAC-SHA1",
+	params := url.Values{
+		"oauth_version":          {"1.0"},
+		"oauth_nonce":            {"random"},
+		"oauth_timestamp":        {"timestamp"},
+		"oauth_consumer_key":     {"abc123"},
+		"oauth_body_hash":        {"bodyhash"},
+		"oauth_signature_method": {"HMAC-SHA1"},
 	}
 
-	s := Signer{URL: "http://example.com"}
+	s := Signer{Method: "POST", URL: "http://example.com"}
 
 	baseString := s.createBaseString(params)
 
@@ -146,21 +161,22 @@ func TestCreateBaseString(t *testing.T) {
 
 func TestSignRequest(t *testing.T) {
 	gen := `6Te1LTOGEnM6qUYIpinnoVO4jms=`
-	params := map[string]string{
-		"oauth_version":          "1.0",
-		"oauth_nonce":            "random",
-		"oauth_timestamp":        "timestamp",
-		"oauth_consumer_key":     "abc123",
-		"oauth_body_hash":        "bodyhash",
-		"oauth_signature_method": "HMAC-SHA1",
+	params := url.Values{
+		"oauth_version":          {"1.0"},
+		"oauth_nonce":            {"random"},
+		"oauth_timestamp":        {"timestamp"},
+		"oauth_consumer_key":     {"abc123"},
+		"oauth_body_hash":        {"bodyhash"},
+		"oauth_signature_method": {"HMAC-SHA1"},
 	}
 
 	s := Signer{
+		Method: "POST",
 		URL:    "http://example.com",
 		Secret: "secret",
 	}
 
-	sig := s.signRequest(params)
+	sig, _ := s.signRequest(params)
 
 	if sig != gen {
 		t.Errorf(`Signature: %s does not match %s`, sig, gen)
@@ -177,7 +193,7 @@ func TestLTISign(t *testing.T) {
 
 	request, err := SignedFormRequest(ts.URL, "1000", "qwerty", formParams)
 	if err != nil {
-		t.Errorf(`Request failed to return: Request: %s Error: %s`, request, err)
+		t.Errorf(`Request failed to return: Request: %v Error: %s`, request, err)
 	}
 
 	client := &http.Client{
@@ -205,13 +221,13 @@ func TestValidateSignature(t *testing.T) {
 	u := "http://example.com"
 	secret := "secret"
 
-	params := map[string]string{
-		"oauth_version":          "1.0",
-		"oauth_nonce":            "random",
-		"oauth_timestamp":        "timestamp",
-		"oauth_consumer_key":     "abc123",
-		"oauth_body_hash":        "bodyhash",
-		"oauth_signature_method": "HMAC-SHA1",
+	params := url.Values{
+		"oauth_version":          {"1.0"},
+		"oauth_nonce":            {"random"},
+		"oauth_timestamp":        {"timestamp"},
+		"oauth_consumer_key":     {"abc123"},
+		"oauth_body_hash":        {"bodyhash"},
+		"oauth_signature_method": {"HMAC-SHA1"},
 	}
 
 	// Generate a signaute from params above
@@ -219,23 +235,111 @@ func TestValidateSignature(t *testing.T) {
 		URL:    u,
 		Secret: secret,
 	}
-	params["oauth_signature"] = s.signRequest(params)
-
-	form := url.Values{}
+	sig, _ := s.signRequest(params)
+	params.Set("oauth_signature", sig)
 
-	for k, v := range params {
-		form.Add(k, v)
-	}
+	form := params
 
 	// Validate that the signature is true
-	b := ValidateSignature(u, form, secret)
+	b := ValidateSignature(u, form, secret, nil)
 	if b == false {
 		t.Errorf(`ValidateSignature could not verify the signaute.`)
 	}
 
 	// Now prove that an incorrect signature returns false
-	b = ValidateSignature(u, form, "wrongSecret")
+	b = ValidateSignature(u, form, "wrongSecret", nil)
 	if b == true {
 		t.Errorf(`ValidateSignature incorrectly verified the signaute.`)
 	}
 }
+
+func TestSignRequestHMACSHA256(t *testing.T) {
+	gen := `5op1kJqjCKgLep4mlanawMi4AjU1LcyF82neNA0oiqk=`
+	params := url.Values{
+		"oauth_version":          {"1.0"},
+		"oauth_nonce":            {"random"},
+		"oauth_timestamp":        {"timestamp"},
+		"oauth_consumer_key":     {"abc123"},
+		"oauth_body_hash":        {"bodyhash"},
+		"oauth_signature_method": {"HMAC-SHA256"},
+	}
+
+	s := Signer{
+		URL:             "http://example.com",
+		Secret:          "secret",
+		SignatureMethod: HMACSHA256,
+	}
+
+	sig, err := s.signRequest(params)
+	if err != nil {
+		t.Fatalf(`signRequest returned an error: %s`, err)
+	}
+
+	if sig != gen {
+		t.Errorf(`Signature: %s does not match %s`, sig, gen)
+	}
+}
+
+func TestSignRequestRSASHA1RoundTrip(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf(`Failed to generate RSA key: %s`, err)
+	}
+
+	params := url.Values{
+		"oauth_version":          {"1.0"},
+		"oauth_nonce":            {"random"},
+		"oauth_timestamp":        {"timestamp"},
+		"oauth_consumer_key":     {"abc123"},
+		"oauth_body_hash":        {"bodyhash"},
+		"oauth_signature_method": {"RSA-SHA1"},
+	}
+
+	s := Signer{
+		URL:             "http://example.com",
+		SignatureMethod: RSASHA1,
+		PrivateKey:      key,
+	}
+
+	sig, err := s.signRequest(params)
+	if err != nil {
+		t.Fatalf(`signRequest returned an error: %s`, err)
+	}
+
+	params.Set("oauth_signature", sig)
+
+	form := params
+
+	resolver := func(consumerKey string) (*rsa.PublicKey, error) {
+		return &key.PublicKey, nil
+	}
+
+	if !ValidateSignature("http://example.com", form, "", resolver) {
+		t.Errorf(`ValidateSignature could not verify the RSA-SHA1 signature.`)
+	}
+}
+
+func TestSignedFormRequestValuesRepeatedKeys(t *testing.T) {
+	params := url.Values{
+		"roles": {"Learner", "Instructor"},
+	}
+
+	request, err := SignedFormRequestValues("http://example.com", "1234", "secret", params)
+	if err != nil {
+		t.Fatalf(`SignedFormRequestValues returned an error: %s`, err)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatalf(`Failed to read signed request body: %s`, err)
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		t.Fatalf(`Failed to parse signed request body: %s`, err)
+	}
+
+	if roles := form["roles"]; len(roles) != 2 {
+		t.Errorf(`Expected both repeated "roles" values to survive signing, got: %v`, roles)
+	}
+}
@@ -0,0 +1,182 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// defaultSpillThreshold is how many body bytes SignRequest buffers in memory before spilling the
+// remainder to a temp file, if WithSpillThreshold is not used to override it.
+const defaultSpillThreshold = 10 << 20 // 10MiB
+
+// signOptions holds SignRequest's optional parameters, set via SignOption functions.
+type signOptions struct {
+	method         SignatureMethod
+	privateKey     *rsa.PrivateKey
+	token          string
+	tokenSecret    string
+	spillThreshold int64
+}
+
+// SignOption configures an optional parameter of SignRequest.
+type SignOption func(*signOptions)
+
+// WithSignatureMethod sets the OAuth signature method SignRequest signs with. Defaults to
+// HMACSHA1.
+func WithSignatureMethod(method SignatureMethod) SignOption {
+	return func(o *signOptions) { o.method = method }
+}
+
+// WithPrivateKey sets the RSA private key SignRequest uses when the signature method is RSASHA1.
+func WithPrivateKey(key *rsa.PrivateKey) SignOption {
+	return func(o *signOptions) { o.privateKey = key }
+}
+
+// WithToken signs on behalf of a 3-legged OAuth 1 AccessToken, as issued by
+// Consumer.AuthorizeToken, including oauth_token in the signed params and tokenSecret in the
+// HMAC key.
+func WithToken(token string, tokenSecret string) SignOption {
+	return func(o *signOptions) {
+		o.token = token
+		o.tokenSecret = tokenSecret
+	}
+}
+
+// WithSpillThreshold sets how many body bytes SignRequest buffers in memory before spilling the
+// remainder to a temp file. Defaults to 10MiB.
+func WithSpillThreshold(bytes int64) SignOption {
+	return func(o *signOptions) { o.spillThreshold = bytes }
+}
+
+// SignRequest signs req in place, for callers that already have a *http.Request to sign (e.g. a
+// multipart upload) rather than a body string to hand to SignedBodyRequest. It hashes req.Body by
+// tee-reading it into a SHA-1 hash while buffering the bytes read, spilling to a temp file once
+// the spill threshold (see WithSpillThreshold) is reached so that large payloads, such as grade-passback XML, are never held
+// fully in memory. req.Body is then reset to the buffered copy, req.ContentLength is set and a
+// valid Authorization header is attached.
+//
+// req.URL's query string is not included in the signed parameters, so SignRequest returns an
+// error if one is present rather than silently signing a base string the receiving Provider
+// would never agree with.
+func SignRequest(req *http.Request, key string, secret string, opts ...SignOption) error {
+	if req.URL.RawQuery != "" {
+		return errors.New("signer: SignRequest does not support requests with a query string")
+	}
+
+	o := signOptions{
+		method:         HMACSHA1,
+		spillThreshold: defaultSpillThreshold,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	hash, bodyReader, size, err := hashAndBufferBody(req.Body, o.spillThreshold)
+	if err != nil {
+		return err
+	}
+
+	req.Body = bodyReader
+	req.ContentLength = size
+
+	s := Signer{
+		Method:          req.Method,
+		URL:             req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+		Key:             key,
+		Secret:          secret,
+		SignatureMethod: o.method,
+		PrivateKey:      o.privateKey,
+		Token:           o.token,
+		TokenSecret:     o.tokenSecret,
+		BodyHash:        hash,
+	}
+
+	h, err := s.BuildAuthHeader()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", h)
+
+	return nil
+}
+
+// hashAndBufferBody consumes body, computing its SHA-1/base64 oauth_body_hash while buffering its
+// bytes into memory. Once spillThreshold bytes have been buffered, the remainder (and what was
+// already buffered) is written out to a temp file instead, which is removed when the returned
+// io.ReadCloser is closed. It returns the hash, a fresh reader over the body and its total size.
+func hashAndBufferBody(body io.ReadCloser, spillThreshold int64) (string, io.ReadCloser, int64, error) {
+	if body == nil || body == http.NoBody {
+		return emptyBodyHash(), http.NoBody, 0, nil
+	}
+	defer body.Close()
+
+	hasher := sha1.New()
+	tee := io.TeeReader(body, hasher)
+
+	var buf bytes.Buffer
+	buffered, err := io.CopyN(&buf, tee, spillThreshold)
+	if err != nil && err != io.EOF {
+		return "", nil, 0, err
+	}
+
+	hash := func() string { return base64.StdEncoding.EncodeToString(hasher.Sum(nil)) }
+
+	if err == io.EOF {
+		// The whole body fit within spillThreshold bytes, no need to touch disk.
+		return hash(), ioutil.NopCloser(bytes.NewReader(buf.Bytes())), buffered, nil
+	}
+
+	tmp, err := ioutil.TempFile("", "signer-body-")
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", nil, 0, err
+	}
+
+	rest, err := io.Copy(tmp, tee)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", nil, 0, err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", nil, 0, err
+	}
+
+	return hash(), &spilledBody{File: tmp}, buffered + rest, nil
+}
+
+// emptyBodyHash is the oauth_body_hash of a zero-length body.
+func emptyBodyHash() string {
+	return base64.StdEncoding.EncodeToString(sha1.New().Sum(nil))
+}
+
+// spilledBody wraps a temp file holding a request body spilled to disk by hashAndBufferBody,
+// removing the file once it's closed.
+type spilledBody struct {
+	*os.File
+}
+
+func (s *spilledBody) Close() error {
+	name := s.File.Name()
+	err := s.File.Close()
+	if rmErr := os.Remove(name); err == nil {
+		err = rmErr
+	}
+	return err
+}
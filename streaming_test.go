@@ -0,0 +1,126 @@
+package signer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignRequestBuffered(t *testing.T) {
+	req, err := http.NewRequest("POST", "http://example.com/callback", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+
+	if err := SignRequest(req, "1234", "abcd"); err != nil {
+		t.Fatalf(`SignRequest returned an error: %s`, err)
+	}
+
+	if req.Header.Get("Authorization") == "" {
+		t.Errorf(`SignRequest did not attach an Authorization header.`)
+	}
+
+	if req.ContentLength != int64(len(body)) {
+		t.Errorf(`Expected ContentLength %d, got %d`, len(body), req.ContentLength)
+	}
+
+	got, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf(`Failed to read signed request body: %s`, err)
+	}
+	if string(got) != body {
+		t.Errorf(`Expected request body to be left readable and unchanged, got: %s`, got)
+	}
+}
+
+func TestSignRequestSpillsToDisk(t *testing.T) {
+	large := strings.Repeat("x", 1024)
+
+	req, err := http.NewRequest("POST", "http://example.com/callback", strings.NewReader(large))
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+
+	if err := SignRequest(req, "1234", "abcd", WithSpillThreshold(16)); err != nil {
+		t.Fatalf(`SignRequest returned an error: %s`, err)
+	}
+
+	if req.ContentLength != int64(len(large)) {
+		t.Errorf(`Expected ContentLength %d, got %d`, len(large), req.ContentLength)
+	}
+
+	got, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf(`Failed to read signed request body: %s`, err)
+	}
+	if string(got) != large {
+		t.Errorf(`Spilled body did not round-trip correctly`)
+	}
+
+	if err := req.Body.Close(); err != nil {
+		t.Errorf(`Closing the spilled body returned an error: %s`, err)
+	}
+}
+
+func TestSignRequestHTTPS(t *testing.T) {
+	p := NewProvider(func(consumerKey string) (string, error) {
+		return "abcd", nil
+	})
+
+	var handlerErr error
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := p.IsAuthorized(r); err != nil {
+			handlerErr = err
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	req, err := http.NewRequest("POST", ts.URL+"/callback", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+
+	if err := SignRequest(req, "1234", "abcd"); err != nil {
+		t.Fatalf(`SignRequest returned an error: %s`, err)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf(`Request failed to send: %s`, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf(`Expected a 200 response now that the signed base string uses the real https scheme, got %d (IsAuthorized error: %s)`, resp.StatusCode, handlerErr)
+	}
+}
+
+func TestSignRequestRejectsQueryString(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://example.com/callback?a=1", nil)
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+
+	if err := SignRequest(req, "1234", "abcd"); err == nil {
+		t.Error(`Expected SignRequest to reject a request with a query string`)
+	}
+}
+
+func TestSignRequestNilBody(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://example.com/callback", nil)
+	if err != nil {
+		t.Fatalf(`Failed to build request: %s`, err)
+	}
+
+	if err := SignRequest(req, "1234", "abcd"); err != nil {
+		t.Fatalf(`SignRequest returned an error: %s`, err)
+	}
+
+	if req.Header.Get("Authorization") == "" {
+		t.Errorf(`SignRequest did not attach an Authorization header.`)
+	}
+}
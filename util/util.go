@@ -2,7 +2,11 @@ package util
 
 import (
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
 )
 
 // RandomString generates a random string
@@ -16,3 +20,28 @@ func RandomString(s int) (string, error) {
 
 	return base64.StdEncoding.EncodeToString(b), nil
 }
+
+// ParseRSAPrivateKeyFromPEM decodes a PEM encoded RSA private key, such as one loaded from disk
+// for RSA-SHA1 OAuth signing, supporting both PKCS1 and PKCS8 encoded keys.
+func ParseRSAPrivateKeyFromPEM(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("util: could not decode PEM block containing private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("util: PEM block does not contain an RSA private key")
+	}
+
+	return rsaKey, nil
+}